@@ -0,0 +1,266 @@
+package runtime
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sync"
+
+	hdrhistogram "github.com/HdrHistogram/hdrhistogram-go"
+	gometrics "github.com/rcrowley/go-metrics"
+)
+
+// MeasureHDR is the Measures key under which an HDR-encoded histogram/timer
+// snapshot is stored when a metric is emitted with WithEmissionMode(EmissionHDR).
+const MeasureHDR = "hdr"
+
+// HDROpts parameterizes the HDR histogram built for "hdr" emission mode.
+type HDROpts struct {
+	// LowestDiscernibleValue is the smallest value the histogram can
+	// distinguish from zero.
+	LowestDiscernibleValue int64
+
+	// HighestTrackableValue caps the magnitude of values the histogram can
+	// record; values above this are clamped to it rather than dropped.
+	HighestTrackableValue int64
+
+	// SignificantFigures is the number of significant decimal digits
+	// preserved by bucket boundaries (1-5).
+	SignificantFigures int64
+}
+
+// DefaultHDROpts is used by NewMetric and MergeHistograms whenever no
+// HDROpts is supplied explicitly.
+var DefaultHDROpts = HDROpts{
+	LowestDiscernibleValue: 1,
+	HighestTrackableValue:  3600 * 1e9, // 1 hour, in nanoseconds.
+	SignificantFigures:     3,
+}
+
+// EmissionMode selects how Histogram/Timer snapshots are serialized by
+// NewMetric.
+type EmissionMode int
+
+const (
+	// EmissionSummary reduces a snapshot to fixed percentiles plus
+	// count/min/max/mean/stddev/variance. This is the original, lossy
+	// behaviour and remains the default.
+	EmissionSummary EmissionMode = iota
+
+	// EmissionHDR instead serializes the full snapshot as a compressed,
+	// exponentially-bucketed HDR histogram (see MeasureHDR), preserving
+	// enough fidelity that percentiles can be recomputed after merging
+	// histograms from every instance in a run; see MergeHistograms.
+	EmissionHDR
+)
+
+// metricOpts collects the options a single NewMetric call was made with.
+type metricOpts struct {
+	mode    EmissionMode
+	hdrOpts HDROpts
+}
+
+// MetricOpt configures a single NewMetric call.
+type MetricOpt func(*metricOpts)
+
+// WithEmissionMode selects how Histogram/Timer snapshots are serialized by
+// a NewMetric call. It has no effect on other metric types.
+func WithEmissionMode(mode EmissionMode) MetricOpt {
+	return func(o *metricOpts) { o.mode = mode }
+}
+
+// WithHDROpts overrides DefaultHDROpts for a single NewMetric call made with
+// WithEmissionMode(EmissionHDR).
+func WithHDROpts(opts HDROpts) MetricOpt {
+	return func(o *metricOpts) { o.hdrOpts = opts }
+}
+
+// sampler is implemented by Histogram snapshots (gometrics.HistogramSnapshot),
+// exposing the gometrics.Sample backing them so populateHDRMeasures can pull
+// the raw recorded values out of it, which EmissionSummary discards but
+// EmissionHDR needs.
+//
+// Timer snapshots (gometrics.TimerSnapshot) have no equivalent accessor in
+// this version of rcrowley/go-metrics: their underlying histogram is an
+// unexported field, so a Timer recorded with EmissionHDR always falls back
+// to an empty histogram below. That's a real fidelity gap for Timer, not
+// something this fix can close without vendoring a patched go-metrics.
+type sampler interface {
+	Sample() gometrics.Sample
+}
+
+// encodeHDR records values into a new HDR histogram and returns it
+// base64-encoded, using the library's own varint-delta-compressed wire
+// format (so the encoding is both compact and independent of bucket count).
+func encodeHDR(values []int64, opts HDROpts) (string, error) {
+	h := hdrhistogram.New(opts.LowestDiscernibleValue, opts.HighestTrackableValue, int(opts.SignificantFigures))
+
+	for _, v := range values {
+		if err := h.RecordValue(v); err != nil {
+			// Out-of-range rather than drop the sample: clamp it to the
+			// configured ceiling so the count still reflects every
+			// observation.
+			_ = h.RecordValue(opts.HighestTrackableValue)
+		}
+	}
+
+	b, err := h.Encode(hdrhistogram.V2CompressedEncodingCookieBase)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode hdr histogram: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// decodeHDR reverses encodeHDR.
+func decodeHDR(enc string) (*hdrhistogram.Histogram, error) {
+	b, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to base64-decode hdr histogram: %w", err)
+	}
+
+	h, err := hdrhistogram.Decode(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode hdr histogram: %w", err)
+	}
+
+	return h, nil
+}
+
+// MergeHistograms merges the HDR-encoded histogram/timer measures carried by
+// ms (see MeasureHDR) into a single Metric, summing bucket counts across all
+// of them so that percentiles can be recomputed server-side across every
+// instance in a run. Metrics that don't carry an "hdr" measure are skipped.
+// MergeHistograms returns an error if none of ms do.
+func MergeHistograms(ms []*Metric) (*Metric, error) {
+	merged := hdrhistogram.New(DefaultHDROpts.LowestDiscernibleValue, DefaultHDROpts.HighestTrackableValue, int(DefaultHDROpts.SignificantFigures))
+
+	var (
+		name    string
+		typ     MetricType
+		ts      int64
+		matched int
+	)
+
+	for _, m := range ms {
+		enc, ok := m.Measures[MeasureHDR].(string)
+		if !ok {
+			continue
+		}
+
+		h, err := decodeHDR(enc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode histogram for metric %q: %w", m.Name, err)
+		}
+
+		if matched == 0 {
+			name, typ = m.Name, m.Type
+		}
+		if m.Timestamp > ts {
+			ts = m.Timestamp
+		}
+
+		merged.Merge(h)
+		matched++
+	}
+
+	if matched == 0 {
+		return nil, fmt.Errorf("no hdr-encoded measures found to merge")
+	}
+
+	b, err := merged.Encode(hdrhistogram.V2CompressedEncodingCookieBase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode merged hdr histogram: %w", err)
+	}
+
+	return &Metric{
+		Timestamp: ts,
+		Type:      typ,
+		Name:      name,
+		Measures: map[string]interface{}{
+			MeasureHDR: base64.StdEncoding.EncodeToString(b),
+			"count":    float64(merged.TotalCount()),
+		},
+	}, nil
+}
+
+// populateHDRMeasures stores an HDR-encoded histogram (see MeasureHDR) in
+// m.Measures, built from the raw values underlying s (a Histogram or Timer
+// snapshot). For a Timer snapshot the raw values are not reachable (see
+// sampler), so the encoded histogram is empty. The "count" measure is always included too, so downstream
+// consumers don't need to decode the histogram just to know how many
+// observations it represents.
+func populateHDRMeasures(m *Metric, s interface{ Count() int64 }, opts HDROpts) {
+	m.Measures["count"] = float64(s.Count())
+
+	var values []int64
+	if sm, ok := s.(sampler); ok {
+		// Histogram snapshots expose their Sample this way; Timer snapshots
+		// don't implement sampler (see the doc comment on sampler), so they
+		// fall through to an empty histogram below.
+		values = sm.Sample().Values()
+	}
+
+	enc, err := encodeHDR(values, opts)
+	if err != nil {
+		// Encoding a well-formed hdrhistogram.Histogram cannot fail in
+		// practice; if it ever does, omit the measure rather than panic.
+		return
+	}
+
+	m.Measures[MeasureHDR] = enc
+}
+
+var (
+	defaultEmissionModeMu sync.Mutex
+	defaultEmissionMode   = EmissionSummary
+)
+
+// SetDefaultMetricEmissionMode sets the process-wide EmissionMode used by
+// NewMetric calls that don't specify WithEmissionMode explicitly and whose
+// RunEnv (if any) hasn't overridden it via WithHistogramEmission.
+func SetDefaultMetricEmissionMode(mode EmissionMode) {
+	defaultEmissionModeMu.Lock()
+	defer defaultEmissionModeMu.Unlock()
+
+	defaultEmissionMode = mode
+}
+
+// getDefaultMetricEmissionMode returns the mode set by
+// SetDefaultMetricEmissionMode, or EmissionSummary if it was never called.
+func getDefaultMetricEmissionMode() EmissionMode {
+	defaultEmissionModeMu.Lock()
+	defer defaultEmissionModeMu.Unlock()
+
+	return defaultEmissionMode
+}
+
+// WithHistogramEmission records on re the EmissionMode that re.metricOpt()
+// supplies to NewMetric, in place of the EmissionSummary default (or
+// whatever SetDefaultMetricEmissionMode set process-wide). It applies only
+// to NewMetric calls given re.metricOpt(); NewMetric does not consult re on
+// its own. Unlike
+// SetDefaultMetricEmissionMode, this is scoped to re, so it is safe to call
+// from multiple RunEnvs sharing a process.
+func (re *RunEnv) WithHistogramEmission(mode EmissionMode) *RunEnv {
+	re.metricEmissionModeMu.Lock()
+	re.metricEmissionMode = &mode
+	re.metricEmissionModeMu.Unlock()
+
+	return re
+}
+
+// metricOpt returns the MetricOpt reflecting re's own emission-mode
+// override, if WithHistogramEmission has been called on re, or a no-op
+// falling back to the process-wide default otherwise. re's metric helpers
+// should prepend this ahead of any opts the caller supplied, so an explicit
+// per-call WithEmissionMode still wins.
+func (re *RunEnv) metricOpt() MetricOpt {
+	re.metricEmissionModeMu.Lock()
+	mode := re.metricEmissionMode
+	re.metricEmissionModeMu.Unlock()
+
+	if mode == nil {
+		return func(*metricOpts) {}
+	}
+	return WithEmissionMode(*mode)
+}
@@ -0,0 +1,163 @@
+package runtime
+
+import (
+	"testing"
+
+	gometrics "github.com/rcrowley/go-metrics"
+)
+
+func TestEncodeDecodeHDRRoundTrip(t *testing.T) {
+	cases := []struct {
+		name   string
+		values []int64
+	}{
+		{"empty", nil},
+		{"single value", []int64{42}},
+		{"many values", []int64{1, 5, 5, 10, 100, 1000, 1000, 1000}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			enc, err := encodeHDR(tc.values, DefaultHDROpts)
+			if err != nil {
+				t.Fatalf("encodeHDR: unexpected error: %v", err)
+			}
+
+			h, err := decodeHDR(enc)
+			if err != nil {
+				t.Fatalf("decodeHDR: unexpected error: %v", err)
+			}
+
+			if got, want := h.TotalCount(), int64(len(tc.values)); got != want {
+				t.Fatalf("decoded histogram count = %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestMergeHistograms(t *testing.T) {
+	enc1, err := encodeHDR([]int64{1, 2, 3}, DefaultHDROpts)
+	if err != nil {
+		t.Fatalf("encodeHDR: unexpected error: %v", err)
+	}
+	enc2, err := encodeHDR([]int64{4, 5}, DefaultHDROpts)
+	if err != nil {
+		t.Fatalf("encodeHDR: unexpected error: %v", err)
+	}
+
+	ms := []*Metric{
+		{Name: "foo", Type: MetricHistogram, Timestamp: 1, Measures: map[string]interface{}{MeasureHDR: enc1}},
+		{Name: "foo", Type: MetricHistogram, Timestamp: 2, Measures: map[string]interface{}{MeasureHDR: enc2}},
+		{Name: "foo", Type: MetricHistogram, Timestamp: 3, Measures: map[string]interface{}{"count": float64(0)}}, // no hdr measure, skipped
+	}
+
+	merged, err := MergeHistograms(ms)
+	if err != nil {
+		t.Fatalf("MergeHistograms: unexpected error: %v", err)
+	}
+
+	if merged.Timestamp != 2 {
+		t.Fatalf("merged.Timestamp = %d, want 2 (the latest matched timestamp)", merged.Timestamp)
+	}
+	if merged.Measures["count"] != float64(5) {
+		t.Fatalf("merged.Measures[count] = %v, want 5", merged.Measures["count"])
+	}
+
+	h, err := decodeHDR(merged.Measures[MeasureHDR].(string))
+	if err != nil {
+		t.Fatalf("decodeHDR(merged): unexpected error: %v", err)
+	}
+	if got, want := h.TotalCount(), int64(5); got != want {
+		t.Fatalf("merged histogram count = %d, want %d", got, want)
+	}
+}
+
+func TestMergeHistogramsNoneMatched(t *testing.T) {
+	ms := []*Metric{
+		{Name: "foo", Type: MetricHistogram, Measures: map[string]interface{}{"count": float64(0)}},
+	}
+
+	if _, err := MergeHistograms(ms); err == nil {
+		t.Fatalf("expected an error when no metric carries an hdr measure")
+	}
+}
+
+// TestNewMetricHDRHistogram goes through NewMetric with a real,
+// populated go-metrics Histogram rather than a hand-built []int64, so it
+// would have caught populateHDRMeasures asserting its snapshot against the
+// wrong interface and silently encoding zero observations.
+func TestNewMetricHDRHistogram(t *testing.T) {
+	h := gometrics.NewHistogram(gometrics.NewUniformSample(1000))
+	for i := int64(1); i <= 50; i++ {
+		h.Update(i)
+	}
+
+	m := NewMetric("test", h, WithEmissionMode(EmissionHDR))
+	if got := m.Measures["count"]; got != float64(50) {
+		t.Fatalf("count = %v, want 50", got)
+	}
+
+	enc, ok := m.Measures[MeasureHDR].(string)
+	if !ok {
+		t.Fatalf("hdr measure missing or wrong type: %v", m.Measures[MeasureHDR])
+	}
+
+	hdr, err := decodeHDR(enc)
+	if err != nil {
+		t.Fatalf("decodeHDR: %v", err)
+	}
+	if got, want := hdr.TotalCount(), int64(50); got != want {
+		t.Fatalf("decoded hdr TotalCount = %d, want %d", got, want)
+	}
+}
+
+// TestNewMetricHDRTimerFallsBackToEmpty documents a real limitation: unlike
+// Histogram, a Timer snapshot (gometrics.TimerSnapshot) has no accessor for
+// its raw recorded values in this version of rcrowley/go-metrics, so
+// EmissionHDR can only encode its count, not its distribution.
+func TestNewMetricHDRTimerFallsBackToEmpty(t *testing.T) {
+	tm := gometrics.NewTimer()
+	for i := int64(1); i <= 10; i++ {
+		tm.Update(1)
+	}
+
+	m := NewMetric("test", tm, WithEmissionMode(EmissionHDR))
+	if got := m.Measures["count"]; got != float64(10) {
+		t.Fatalf("count = %v, want 10", got)
+	}
+
+	enc, ok := m.Measures[MeasureHDR].(string)
+	if !ok {
+		t.Fatalf("hdr measure missing or wrong type: %v", m.Measures[MeasureHDR])
+	}
+	hdr, err := decodeHDR(enc)
+	if err != nil {
+		t.Fatalf("decodeHDR: %v", err)
+	}
+	if got, want := hdr.TotalCount(), int64(0); got != want {
+		t.Fatalf("decoded hdr TotalCount = %d, want %d (Timer snapshots can't expose raw values)", got, want)
+	}
+}
+
+// TestRunEnvWithHistogramEmissionScopedNotGlobal guards against
+// WithHistogramEmission regressing into a process-wide setting: a mode set
+// on one RunEnv must not be observable through another RunEnv's metricOpt.
+func TestRunEnvWithHistogramEmissionScopedNotGlobal(t *testing.T) {
+	re1 := &RunEnv{}
+	re2 := &RunEnv{}
+
+	re1.WithHistogramEmission(EmissionHDR)
+
+	h := gometrics.NewHistogram(gometrics.NewUniformSample(1000))
+	h.Update(1)
+
+	m1 := NewMetric("h", h, re1.metricOpt())
+	if _, ok := m1.Measures[MeasureHDR]; !ok {
+		t.Fatalf("re1 metric missing hdr measure; WithHistogramEmission had no effect")
+	}
+
+	m2 := NewMetric("h", h, re2.metricOpt())
+	if _, ok := m2.Measures[MeasureHDR]; ok {
+		t.Fatalf("re2 metric carries hdr measure; re1's WithHistogramEmission leaked process-wide")
+	}
+}
@@ -0,0 +1,499 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// MetricSink receives Metric records emitted by a RunEnv and forwards them to
+// a downstream observability system. A RunEnv may have any number of sinks
+// registered via AddMetricSink; every sink whose MetricFilter matches
+// receives every metric the RunEnv passes to emitToSinks. NewMetric itself
+// builds a Metric without forwarding it to any sink.
+type MetricSink interface {
+	// Emit processes a single metric record. Implementations must not retain
+	// m beyond the call, since the caller may Release() it afterwards.
+	Emit(m *Metric) error
+
+	// Flush forces delivery of any metrics buffered internally by the sink.
+	Flush() error
+
+	// Close releases resources held by the sink (connections, file handles,
+	// background goroutines). No further calls to Emit are permitted once
+	// Close returns.
+	Close() error
+}
+
+// MetricFilter restricts a MetricSink to a subset of the metrics emitted by a
+// RunEnv. The zero value matches every metric.
+type MetricFilter struct {
+	// Types, if non-empty, restricts emission to these MetricTypes.
+	Types []MetricType
+
+	// NameGlob, if non-empty, restricts emission to metrics whose Name
+	// matches this shell glob pattern; see path/filepath.Match.
+	NameGlob string
+}
+
+// Match reports whether m satisfies this filter.
+func (f MetricFilter) Match(m *Metric) bool {
+	if len(f.Types) > 0 {
+		var ok bool
+		for _, t := range f.Types {
+			if t == m.Type {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	if f.NameGlob != "" {
+		if ok, _ := filepath.Match(f.NameGlob, m.Name); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// filteredSink pairs a registered MetricSink with the filter that gates it.
+type filteredSink struct {
+	MetricSink
+	filter MetricFilter
+}
+
+// SinkFactory constructs a MetricSink from a free-form configuration value.
+// Factories are registered with RegisterSinkFactory and looked up by name,
+// allowing a sink to be selected via configuration (e.g. an env var) rather
+// than an import.
+type SinkFactory func(config interface{}) (MetricSink, error)
+
+var (
+	sinkFactoriesMu sync.Mutex
+	sinkFactories   = map[string]SinkFactory{}
+)
+
+// RegisterSinkFactory makes a MetricSink implementation constructible by
+// name via NewSink. It panics if name is already registered.
+func RegisterSinkFactory(name string, factory SinkFactory) {
+	sinkFactoriesMu.Lock()
+	defer sinkFactoriesMu.Unlock()
+
+	if _, dup := sinkFactories[name]; dup {
+		panic(fmt.Sprintf("runtime: SinkFactory already registered under name %q", name))
+	}
+	sinkFactories[name] = factory
+}
+
+// NewSink constructs a MetricSink previously registered under name via
+// RegisterSinkFactory.
+func NewSink(name string, config interface{}) (MetricSink, error) {
+	sinkFactoriesMu.Lock()
+	factory, ok := sinkFactories[name]
+	sinkFactoriesMu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("runtime: no MetricSink registered under name %q", name)
+	}
+	return factory(config)
+}
+
+func init() {
+	RegisterSinkFactory("json", func(config interface{}) (MetricSink, error) {
+		w, ok := config.(io.Writer)
+		if !ok {
+			return nil, fmt.Errorf("json sink requires an io.Writer config, got %T", config)
+		}
+		return NewJSONSink(w), nil
+	})
+
+	RegisterSinkFactory("prometheus", func(config interface{}) (MetricSink, error) {
+		addr, ok := config.(string)
+		if !ok {
+			return nil, fmt.Errorf("prometheus sink requires a listen address string config, got %T", config)
+		}
+		return NewPrometheusSink(addr)
+	})
+
+	RegisterSinkFactory("otlp", func(config interface{}) (MetricSink, error) {
+		endpoint, ok := config.(string)
+		if !ok {
+			return nil, fmt.Errorf("otlp sink requires a collector endpoint string config, got %T", config)
+		}
+		return NewOTLPSink(context.Background(), endpoint)
+	})
+}
+
+// AddMetricSink registers sink to receive every metric subsequently passed
+// to re's emitToSinks that matches filter; metrics built by NewMetric are not
+// forwarded to it on their own. Sinks are invoked synchronously, in
+// registration order; a slow sink will stall metric emission for the run.
+func (re *RunEnv) AddMetricSink(sink MetricSink, filter MetricFilter) {
+	re.sinksMu.Lock()
+	defer re.sinksMu.Unlock()
+
+	re.sinks = append(re.sinks, filteredSink{MetricSink: sink, filter: filter})
+}
+
+// emitToSinks forwards m to every registered sink whose filter matches it.
+// The caller retains ownership of m.
+func (re *RunEnv) emitToSinks(m *Metric) {
+	re.sinksMu.Lock()
+	sinks := re.sinks
+	re.sinksMu.Unlock()
+
+	for _, fs := range sinks {
+		if !fs.filter.Match(m) {
+			continue
+		}
+		if err := fs.Emit(m); err != nil {
+			re.SLogger().Warnw("metric sink failed to emit metric", "name", m.Name, "error", err)
+		}
+	}
+}
+
+// FlushMetricSinks flushes every sink registered via AddMetricSink. It is
+// typically called once at the end of a run, before the RunEnv is closed.
+func (re *RunEnv) FlushMetricSinks() {
+	re.sinksMu.Lock()
+	sinks := re.sinks
+	re.sinksMu.Unlock()
+
+	for _, fs := range sinks {
+		if err := fs.Flush(); err != nil {
+			re.SLogger().Warnw("metric sink failed to flush", "error", err)
+		}
+	}
+}
+
+// CloseMetricSinks closes every sink registered via AddMetricSink, collecting
+// and returning the first error encountered (if any), after attempting to
+// close all of them.
+func (re *RunEnv) CloseMetricSinks() error {
+	re.sinksMu.Lock()
+	sinks := re.sinks
+	re.sinks = nil
+	re.sinksMu.Unlock()
+
+	var err error
+	for _, fs := range sinks {
+		if cerr := fs.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// JSONSink is the original MetricSink behaviour: every Metric is serialized
+// to a single JSON line and written to an underlying io.Writer (typically
+// the run's structured log).
+type JSONSink struct {
+	mu  sync.Mutex
+	w   io.Writer
+	enc *json.Encoder
+}
+
+// NewJSONSink returns a MetricSink that writes newline-delimited JSON
+// encodings of each Metric to w.
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{w: w, enc: json.NewEncoder(w)}
+}
+
+func (s *JSONSink) Emit(m *Metric) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.enc.Encode(m)
+}
+
+func (s *JSONSink) Flush() error {
+	if f, ok := s.w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (s *JSONSink) Close() error {
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// PrometheusSink translates Metric records into Prometheus collectors,
+// served via a pull-based /metrics HTTP endpoint.
+type PrometheusSink struct {
+	registry *prometheus.Registry
+	server   *http.Server
+
+	mu        sync.Mutex
+	gauges    map[string]*prometheus.GaugeVec
+	counters  map[string]*prometheus.CounterVec
+	summaries map[string]*prometheus.SummaryVec
+}
+
+// NewPrometheusSink starts an HTTP server on addr serving a Prometheus
+// /metrics endpoint, and returns a MetricSink that populates it.
+func NewPrometheusSink(addr string) (*PrometheusSink, error) {
+	registry := prometheus.NewRegistry()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	s := &PrometheusSink{
+		registry:  registry,
+		server:    &http.Server{Addr: addr, Handler: mux},
+		gauges:    make(map[string]*prometheus.GaugeVec),
+		counters:  make(map[string]*prometheus.CounterVec),
+		summaries: make(map[string]*prometheus.SummaryVec),
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind prometheus sink to %q: %w", addr, err)
+	}
+	go s.server.Serve(ln)
+
+	return s, nil
+}
+
+func (s *PrometheusSink) Emit(m *Metric) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch m.Type {
+	case MetricCounter:
+		c, ok := s.counters[m.Name]
+		if !ok {
+			c = prometheus.NewCounterVec(prometheus.CounterOpts{Name: sanitizeMetricName(m.Name)}, nil)
+			s.registry.MustRegister(c)
+			s.counters[m.Name] = c
+		}
+		if count, ok := m.Measures["count"].(float64); ok {
+			c.WithLabelValues().Add(count)
+		}
+
+	case MetricGauge, MetricPoint, MetricEWMA:
+		g, ok := s.gauges[m.Name]
+		if !ok {
+			g = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: sanitizeMetricName(m.Name)}, nil)
+			s.registry.MustRegister(g)
+			s.gauges[m.Name] = g
+		}
+		for _, key := range []string{"value", "rate"} {
+			if v, ok := m.Measures[key].(float64); ok {
+				g.WithLabelValues().Set(v)
+			}
+		}
+
+	case MetricHistogram, MetricTimer, MetricMeter:
+		sm, ok := s.summaries[m.Name]
+		if !ok {
+			sm = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+				Name: sanitizeMetricName(m.Name),
+				Objectives: map[float64]float64{
+					0.5: 0.01, 0.75: 0.01, 0.95: 0.005, 0.99: 0.001, 0.999: 0.0005, 0.9999: 0.00005,
+				},
+			}, nil)
+			s.registry.MustRegister(sm)
+			s.summaries[m.Name] = sm
+		}
+		// The histogram/timer/meter snapshot only carries pre-computed
+		// percentiles, not raw observations, so we record the mean as a
+		// single observation; the percentiles are not exported by this sink
+		// (nor by OTLPSink, which also records only the mean). A metric
+		// emitted with EmissionHDR carries no "mean" and records nothing
+		// here; its distribution is only available via MergeHistograms.
+		if mean, ok := m.Measures["mean"].(float64); ok {
+			sm.WithLabelValues().Observe(mean)
+		}
+	}
+
+	return nil
+}
+
+func (s *PrometheusSink) Flush() error { return nil }
+
+func (s *PrometheusSink) Close() error {
+	return s.server.Close()
+}
+
+// sanitizeMetricName rewrites a testground metric name into the subset of
+// characters Prometheus allows in a metric name.
+func sanitizeMetricName(name string) string {
+	r := []rune(name)
+	for i, c := range r {
+		if !(c == '_' || c == ':' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+			r[i] = '_'
+		}
+	}
+	return string(r)
+}
+
+// OTLPSink pushes Metric records to an OpenTelemetry Collector over OTLP, by
+// translating every emitted Metric into a recording on a cached OTel
+// instrument of the corresponding kind.
+type OTLPSink struct {
+	reader   *sdkmetric.PeriodicReader
+	provider *sdkmetric.MeterProvider
+	meter    metric.Meter
+
+	mu sync.Mutex
+	// counters backs MetricCounter. updowns backs MetricGauge/MetricPoint/
+	// MetricEWMA: the stable OTel metric API has no synchronous gauge
+	// instrument, so an UpDownCounter is used and populated via Add of the
+	// delta from its last recorded value, which is the idiomatic
+	// workaround OTel itself documents for this gap. histograms backs
+	// MetricHistogram/MetricTimer/MetricMeter.
+	counters   map[string]metric.Float64Counter
+	updowns    map[string]otlpGauge
+	histograms map[string]metric.Float64Histogram
+}
+
+// otlpGauge pairs an UpDownCounter with the last value recorded through it,
+// so Emit can translate an absolute Gauge/Point/EWMA reading into the Add
+// delta the instrument actually expects.
+type otlpGauge struct {
+	counter metric.Float64UpDownCounter
+	last    float64
+}
+
+// NewOTLPSink dials endpoint (an OTLP/gRPC collector address) and returns a
+// MetricSink that pushes every emitted Metric as an OTel instrument
+// recording, flushed on an internal periodic schedule or by Flush.
+func NewOTLPSink(ctx context.Context, endpoint string) (*OTLPSink, error) {
+	exporter, err := otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithEndpoint(endpoint), otlpmetricgrpc.WithInsecure())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create otlp exporter: %w", err)
+	}
+
+	reader := sdkmetric.NewPeriodicReader(exporter)
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	return &OTLPSink{
+		reader:     reader,
+		provider:   provider,
+		meter:      provider.Meter("github.com/testground/sdk-go/runtime"),
+		counters:   make(map[string]metric.Float64Counter),
+		updowns:    make(map[string]otlpGauge),
+		histograms: make(map[string]metric.Float64Histogram),
+	}, nil
+}
+
+func (s *OTLPSink) Emit(m *Metric) error {
+	ctx := context.Background()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch m.Type {
+	case MetricCounter:
+		c, err := s.counterFor(m.Name)
+		if err != nil {
+			return err
+		}
+		if count, ok := m.Measures["count"].(float64); ok {
+			c.Add(ctx, count)
+		}
+
+	case MetricGauge, MetricPoint, MetricEWMA:
+		var (
+			key string
+			ok  bool
+			v   float64
+		)
+		for _, key = range []string{"value", "rate"} {
+			if v, ok = m.Measures[key].(float64); ok {
+				break
+			}
+		}
+		if !ok {
+			return nil
+		}
+
+		g, err := s.updownFor(m.Name)
+		if err != nil {
+			return err
+		}
+		g.counter.Add(ctx, v-g.last)
+		s.updowns[m.Name] = otlpGauge{counter: g.counter, last: v}
+
+	case MetricHistogram, MetricTimer, MetricMeter:
+		h, err := s.histogramFor(m.Name)
+		if err != nil {
+			return err
+		}
+		if mean, ok := m.Measures["mean"].(float64); ok {
+			h.Record(ctx, mean)
+		}
+	}
+
+	return nil
+}
+
+// counterFor returns the cached Float64Counter for name, creating it if this
+// is the first metric emitted under that name. Callers must hold s.mu.
+func (s *OTLPSink) counterFor(name string) (metric.Float64Counter, error) {
+	if c, ok := s.counters[name]; ok {
+		return c, nil
+	}
+	c, err := s.meter.Float64Counter(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create otlp counter instrument %q: %w", name, err)
+	}
+	s.counters[name] = c
+	return c, nil
+}
+
+// updownFor returns the cached otlpGauge for name, creating it if this is
+// the first metric emitted under that name. Callers must hold s.mu.
+func (s *OTLPSink) updownFor(name string) (otlpGauge, error) {
+	if g, ok := s.updowns[name]; ok {
+		return g, nil
+	}
+	c, err := s.meter.Float64UpDownCounter(name)
+	if err != nil {
+		return otlpGauge{}, fmt.Errorf("failed to create otlp gauge instrument %q: %w", name, err)
+	}
+	g := otlpGauge{counter: c}
+	s.updowns[name] = g
+	return g, nil
+}
+
+// histogramFor returns the cached Float64Histogram for name, creating it if
+// this is the first metric emitted under that name. Callers must hold s.mu.
+func (s *OTLPSink) histogramFor(name string) (metric.Float64Histogram, error) {
+	if h, ok := s.histograms[name]; ok {
+		return h, nil
+	}
+	h, err := s.meter.Float64Histogram(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create otlp histogram instrument %q: %w", name, err)
+	}
+	s.histograms[name] = h
+	return h, nil
+}
+
+func (s *OTLPSink) Flush() error {
+	return s.reader.ForceFlush(context.Background())
+}
+
+func (s *OTLPSink) Close() error {
+	return s.provider.Shutdown(context.Background())
+}
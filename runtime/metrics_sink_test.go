@@ -0,0 +1,162 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	gometrics "github.com/rcrowley/go-metrics"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestMetricFilterMatch(t *testing.T) {
+	cases := []struct {
+		name   string
+		filter MetricFilter
+		m      *Metric
+		want   bool
+	}{
+		{
+			name:   "zero value matches everything",
+			filter: MetricFilter{},
+			m:      &Metric{Name: "foo", Type: MetricCounter},
+			want:   true,
+		},
+		{
+			name:   "type allowed",
+			filter: MetricFilter{Types: []MetricType{MetricCounter, MetricGauge}},
+			m:      &Metric{Name: "foo", Type: MetricGauge},
+			want:   true,
+		},
+		{
+			name:   "type excluded",
+			filter: MetricFilter{Types: []MetricType{MetricCounter}},
+			m:      &Metric{Name: "foo", Type: MetricGauge},
+			want:   false,
+		},
+		{
+			name:   "name glob matches",
+			filter: MetricFilter{NameGlob: "net/*"},
+			m:      &Metric{Name: "net/bytes_sent", Type: MetricCounter},
+			want:   true,
+		},
+		{
+			name:   "name glob excludes",
+			filter: MetricFilter{NameGlob: "net/*"},
+			m:      &Metric{Name: "disk/bytes_written", Type: MetricCounter},
+			want:   false,
+		},
+		{
+			name:   "type and name glob both must match",
+			filter: MetricFilter{Types: []MetricType{MetricCounter}, NameGlob: "net/*"},
+			m:      &Metric{Name: "net/bytes_sent", Type: MetricGauge},
+			want:   false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.filter.Match(tc.m); got != tc.want {
+				t.Fatalf("Match() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeMetricName(t *testing.T) {
+	cases := map[string]string{
+		"foo_bar":      "foo_bar",
+		"foo.bar":      "foo_bar",
+		"foo/bar:baz":  "foo_bar:baz",
+		"foo-bar 123":  "foo_bar_123",
+		"already_ok_1": "already_ok_1",
+	}
+
+	for in, want := range cases {
+		if got := sanitizeMetricName(in); got != want {
+			t.Errorf("sanitizeMetricName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// TestPrometheusSinkEmitCounterAndGauge exercises Emit against real
+// go-metrics Counter/Gauge values rather than hand-built Metrics, so it
+// would have caught NewMetric storing these measures as int64 instead of
+// the float64 Emit asserts against.
+func TestPrometheusSinkEmitCounterAndGauge(t *testing.T) {
+	s := &PrometheusSink{
+		registry:  prometheus.NewRegistry(),
+		gauges:    make(map[string]*prometheus.GaugeVec),
+		counters:  make(map[string]*prometheus.CounterVec),
+		summaries: make(map[string]*prometheus.SummaryVec),
+	}
+
+	c := gometrics.NewCounter()
+	c.Inc(5)
+	if err := s.Emit(NewMetric("reqs", c)); err != nil {
+		t.Fatalf("Emit(counter): %v", err)
+	}
+	if got := testutil.ToFloat64(s.counters["reqs"]); got != 5 {
+		t.Fatalf("counter value = %v, want 5", got)
+	}
+
+	g := gometrics.NewGauge()
+	g.Update(7)
+	if err := s.Emit(NewMetric("inflight", g)); err != nil {
+		t.Fatalf("Emit(gauge): %v", err)
+	}
+	if got := testutil.ToFloat64(s.gauges["inflight"]); got != 7 {
+		t.Fatalf("gauge value = %v, want 7", got)
+	}
+}
+
+// TestOTLPSinkEmitCounterAndGauge is the OTLPSink analogue of
+// TestPrometheusSinkEmitCounterAndGauge.
+func TestOTLPSinkEmitCounterAndGauge(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	s := &OTLPSink{
+		provider:   provider,
+		meter:      provider.Meter("test"),
+		counters:   make(map[string]metric.Float64Counter),
+		updowns:    make(map[string]otlpGauge),
+		histograms: make(map[string]metric.Float64Histogram),
+	}
+
+	c := gometrics.NewCounter()
+	c.Inc(5)
+	if err := s.Emit(NewMetric("reqs", c)); err != nil {
+		t.Fatalf("Emit(counter): %v", err)
+	}
+
+	g := gometrics.NewGauge()
+	g.Update(7)
+	if err := s.Emit(NewMetric("inflight", g)); err != nil {
+		t.Fatalf("Emit(gauge): %v", err)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+
+	got := map[string]float64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if d, ok := m.Data.(metricdata.Sum[float64]); ok {
+				got[m.Name] = d.DataPoints[0].Value
+			}
+		}
+	}
+
+	if got["reqs"] != 5 {
+		t.Fatalf("reqs = %v, want 5", got["reqs"])
+	}
+	if got["inflight"] != 7 {
+		t.Fatalf("inflight = %v, want 7", got["inflight"])
+	}
+}
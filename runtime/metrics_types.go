@@ -41,13 +41,18 @@ func (m *Metric) Release() {
 	pools[m.Type].Put(m)
 }
 
-func NewMetric(name string, i interface{}) *Metric {
+func NewMetric(name string, i interface{}, opts ...MetricOpt) *Metric {
 	var (
 		m  *Metric
 		t  MetricType
 		ts = time.Now().UnixNano()
 	)
 
+	mo := metricOpts{mode: getDefaultMetricEmissionMode(), hdrOpts: DefaultHDROpts}
+	for _, opt := range opts {
+		opt(&mo)
+	}
+
 	switch v := i.(type) {
 	case Point:
 		t = MetricPoint
@@ -58,7 +63,7 @@ func NewMetric(name string, i interface{}) *Metric {
 		t = MetricCounter
 		m = pools[t].Get().(*Metric)
 		s := v.Snapshot()
-		m.Measures["count"] = s.Count()
+		m.Measures["count"] = float64(s.Count())
 
 	case EWMA:
 		t = MetricEWMA
@@ -70,25 +75,30 @@ func NewMetric(name string, i interface{}) *Metric {
 		t = MetricGauge
 		m = pools[t].Get().(*Metric)
 		s := v.Snapshot()
-		m.Measures["value"] = s.Value()
+		m.Measures["value"] = float64(s.Value())
 
 	case Histogram:
 		t = MetricHistogram
 		m = pools[t].Get().(*Metric)
 		s := v.Snapshot()
-		p := s.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999, 0.9999})
-		m.Measures["count"] = float64(s.Count())
-		m.Measures["max"] = float64(s.Max())
-		m.Measures["mean"] = s.Mean()
-		m.Measures["min"] = float64(s.Min())
-		m.Measures["stddev"] = s.StdDev()
-		m.Measures["variance"] = s.Variance()
-		m.Measures["p50"] = p[0]
-		m.Measures["p75"] = p[1]
-		m.Measures["p95"] = p[2]
-		m.Measures["p99"] = p[3]
-		m.Measures["p999"] = p[4]
-		m.Measures["p9999"] = p[5]
+
+		if mo.mode == EmissionHDR {
+			populateHDRMeasures(m, s, mo.hdrOpts)
+		} else {
+			p := s.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999, 0.9999})
+			m.Measures["count"] = float64(s.Count())
+			m.Measures["max"] = float64(s.Max())
+			m.Measures["mean"] = s.Mean()
+			m.Measures["min"] = float64(s.Min())
+			m.Measures["stddev"] = s.StdDev()
+			m.Measures["variance"] = s.Variance()
+			m.Measures["p50"] = p[0]
+			m.Measures["p75"] = p[1]
+			m.Measures["p95"] = p[2]
+			m.Measures["p99"] = p[3]
+			m.Measures["p999"] = p[4]
+			m.Measures["p9999"] = p[5]
+		}
 
 	case Meter:
 		t = MetricMeter
@@ -104,19 +114,24 @@ func NewMetric(name string, i interface{}) *Metric {
 		t = MetricTimer
 		m = pools[t].Get().(*Metric)
 		s := v.Snapshot()
-		p := s.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999, 0.9999})
-		m.Measures["count"] = float64(s.Count())
-		m.Measures["max"] = float64(s.Max())
-		m.Measures["mean"] = s.Mean()
-		m.Measures["min"] = float64(s.Min())
-		m.Measures["stddev"] = s.StdDev()
-		m.Measures["variance"] = s.Variance()
-		m.Measures["p50"] = p[0]
-		m.Measures["p75"] = p[1]
-		m.Measures["p95"] = p[2]
-		m.Measures["p99"] = p[3]
-		m.Measures["p999"] = p[4]
-		m.Measures["p9999"] = p[5]
+
+		if mo.mode == EmissionHDR {
+			populateHDRMeasures(m, s, mo.hdrOpts)
+		} else {
+			p := s.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999, 0.9999})
+			m.Measures["count"] = float64(s.Count())
+			m.Measures["max"] = float64(s.Max())
+			m.Measures["mean"] = s.Mean()
+			m.Measures["min"] = float64(s.Min())
+			m.Measures["stddev"] = s.StdDev()
+			m.Measures["variance"] = s.Variance()
+			m.Measures["p50"] = p[0]
+			m.Measures["p75"] = p[1]
+			m.Measures["p95"] = p[2]
+			m.Measures["p99"] = p[3]
+			m.Measures["p999"] = p[4]
+			m.Measures["p9999"] = p[5]
+		}
 		m.Measures["m1"] = s.Rate1()
 		m.Measures["m5"] = s.Rate5()
 		m.Measures["m15"] = s.Rate15()
@@ -0,0 +1,36 @@
+package runtime
+
+import "sync"
+
+var (
+	redisResettersMu sync.Mutex
+	redisResetters   []func()
+)
+
+// RegisterRedisClientResetter registers fn to be called by ResetRedisClients.
+// It is called by packages (notably sync) that maintain a process-wide pool
+// of shared Redis clients, so that tests can force a clean slate between
+// runs without restarting the process.
+func RegisterRedisClientResetter(fn func()) {
+	redisResettersMu.Lock()
+	defer redisResettersMu.Unlock()
+
+	redisResetters = append(redisResetters, fn)
+}
+
+// ResetRedisClients tears down every shared Redis client pool registered via
+// RegisterRedisClientResetter, regardless of outstanding reference counts.
+//
+// It is intended for use in test suites that construct many sync clients in
+// the same process and need to guarantee a fresh connection pool between
+// cases; it is not safe to call while any client backed by the pool is still
+// in use.
+func ResetRedisClients() {
+	redisResettersMu.Lock()
+	fns := append([]func(){}, redisResetters...)
+	redisResettersMu.Unlock()
+
+	for _, fn := range fns {
+		fn()
+	}
+}
@@ -0,0 +1,88 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/go-redis/redis/v7"
+)
+
+func TestParseRedisURI(t *testing.T) {
+	cases := []struct {
+		name    string
+		uri     string
+		want    *redis.UniversalOptions
+		wantErr bool
+	}{
+		{
+			name: "standalone",
+			uri:  "redis://localhost:6379/1",
+			want: &redis.UniversalOptions{Addrs: []string{"localhost:6379"}, DB: 1},
+		},
+		{
+			name: "standalone with password",
+			uri:  "redis://:s3cr3t@localhost:6379",
+			want: &redis.UniversalOptions{Addrs: []string{"localhost:6379"}, Password: "s3cr3t"},
+		},
+		{
+			name: "standalone tls",
+			uri:  "rediss://localhost:6379",
+			want: &redis.UniversalOptions{Addrs: []string{"localhost:6379"}},
+		},
+		{
+			name: "sentinel",
+			uri:  "redis-sentinel://mymaster@host1:26379,host2:26379,host3:26379/2",
+			want: &redis.UniversalOptions{MasterName: "mymaster", Addrs: []string{"host1:26379", "host2:26379", "host3:26379"}, DB: 2},
+		},
+		{
+			name: "cluster",
+			uri:  "redis-cluster://host1:6379,host2:6379",
+			want: &redis.UniversalOptions{Addrs: []string{"host1:6379", "host2:6379"}},
+		},
+		{
+			name:    "unsupported scheme",
+			uri:     "memcached://localhost:11211",
+			wantErr: true,
+		},
+		{
+			name:    "invalid db",
+			uri:     "redis://localhost:6379/not-a-number",
+			wantErr: true,
+		},
+		{
+			name:    "rejects undocumented query parameters",
+			uri:     "redis-cluster://?addrs=host1:6379,host2:6379",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseRedisURI(tc.uri)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("parseRedisURI(%q): expected error, got none", tc.uri)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRedisURI(%q): unexpected error: %v", tc.uri, err)
+			}
+
+			if got.MasterName != tc.want.MasterName || got.Password != tc.want.Password || got.DB != tc.want.DB {
+				t.Fatalf("parseRedisURI(%q) = %+v, want %+v", tc.uri, got, tc.want)
+			}
+			if len(got.Addrs) != len(tc.want.Addrs) {
+				t.Fatalf("parseRedisURI(%q) addrs = %v, want %v", tc.uri, got.Addrs, tc.want.Addrs)
+			}
+			for i := range got.Addrs {
+				if got.Addrs[i] != tc.want.Addrs[i] {
+					t.Fatalf("parseRedisURI(%q) addrs = %v, want %v", tc.uri, got.Addrs, tc.want.Addrs)
+				}
+			}
+
+			if tc.uri == "rediss://localhost:6379" && got.TLSConfig == nil {
+				t.Fatalf("parseRedisURI(%q): expected TLSConfig to be set", tc.uri)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/testground/sdk-go/runtime"
+
+	"github.com/go-redis/redis/v7"
+	"go.uber.org/zap"
+)
+
+// pooledRedisClientsMu guards pooledRedisClients.
+var pooledRedisClientsMu sync.Mutex
+
+// pooledRedisClients holds the one shared *pooledRedisClient per resolved
+// Redis DSN within this process. It is keyed by redisDSN(uopts), so that
+// distinct DefaultClients connecting to the same topology (same host(s),
+// master name, and DB) reuse a single underlying connection pool instead of
+// each opening their own.
+var pooledRedisClients = map[string]*pooledRedisClient{}
+
+func init() {
+	runtime.RegisterRedisClientResetter(resetRedisClients)
+}
+
+// pooledRedisClient wraps a redis.UniversalClient with a reference count, so
+// that Close only tears down the pool once every DefaultClient that acquired
+// it has released it.
+type pooledRedisClient struct {
+	redis.UniversalClient
+
+	dsn string
+
+	mu   sync.Mutex
+	refs int
+}
+
+// acquireRedisClient returns the shared pooledRedisClient for uopts' resolved
+// DSN, creating and pinging one if this is the first acquisition, along with
+// a release func that must be called exactly once (typically from
+// DefaultClient.Close) in place of calling Close on the returned client.
+func acquireRedisClient(ctx context.Context, log *zap.SugaredLogger, uopts *redis.UniversalOptions) (client redis.UniversalClient, release func() error, err error) {
+	dsn := redisDSN(uopts)
+
+	pooledRedisClientsMu.Lock()
+	if pc, ok := pooledRedisClients[dsn]; ok {
+		pc.mu.Lock()
+		pc.refs++
+		pc.mu.Unlock()
+		pooledRedisClientsMu.Unlock()
+
+		log.Debugw("reusing shared redis client", "dsn", dsn, "refs", pc.refs)
+		return pc, pc.release, nil
+	}
+	pooledRedisClientsMu.Unlock()
+
+	// redis.UniversalClient has no WithContext method (only the concrete
+	// *redis.Client/*redis.ClusterClient/*redis.Ring do), so ctx isn't
+	// threaded into the client itself; lifetime is governed by release.
+	rc := redis.NewUniversalClient(uopts)
+	if err := rc.Ping().Err(); err != nil {
+		_ = rc.Close()
+		log.Errorw("failed to ping redis", "addrs", uopts.Addrs, "error", err)
+		return nil, nil, err
+	}
+
+	log.Debugw("redis ping OK", "addrs", uopts.Addrs)
+
+	pc := &pooledRedisClient{UniversalClient: rc, dsn: dsn, refs: 1}
+
+	pooledRedisClientsMu.Lock()
+	if existing, ok := pooledRedisClients[dsn]; ok {
+		// Lost a race with a concurrent acquireRedisClient for the same DSN;
+		// discard our client and use theirs.
+		existing.mu.Lock()
+		existing.refs++
+		existing.mu.Unlock()
+		pooledRedisClientsMu.Unlock()
+
+		_ = rc.Close()
+		return existing, existing.release, nil
+	}
+	pooledRedisClients[dsn] = pc
+	pooledRedisClientsMu.Unlock()
+
+	return pc, pc.release, nil
+}
+
+// release decrements pc's reference count, closing and evicting the shared
+// client once the last holder has released it.
+func (pc *pooledRedisClient) release() error {
+	pc.mu.Lock()
+	pc.refs--
+	last := pc.refs <= 0
+	pc.mu.Unlock()
+
+	if !last {
+		return nil
+	}
+
+	pooledRedisClientsMu.Lock()
+	if pooledRedisClients[pc.dsn] == pc {
+		delete(pooledRedisClients, pc.dsn)
+	}
+	pooledRedisClientsMu.Unlock()
+
+	return pc.UniversalClient.Close()
+}
+
+// resetRedisClients forcibly closes and evicts every shared Redis client
+// pool, regardless of outstanding reference counts. It is registered with
+// runtime.ResetRedisClients, and is intended for use in tests that need a
+// clean slate between runs sharing the same process.
+func resetRedisClients() {
+	pooledRedisClientsMu.Lock()
+	clients := pooledRedisClients
+	pooledRedisClients = map[string]*pooledRedisClient{}
+	pooledRedisClientsMu.Unlock()
+
+	for _, pc := range clients {
+		_ = pc.UniversalClient.Close()
+	}
+}
+
+// redisDSN computes a stable key identifying the Redis topology and
+// credentials described by uopts, used to deduplicate pooledRedisClients
+// across DefaultClients connecting to the same endpoint(s).
+//
+// Username, Password, and whether TLS is enabled are folded into the key
+// alongside the addresses, master name, and DB: two DefaultClients resolving
+// to the same address(es) but with different credentials or TLS settings
+// must never share a pooled connection, since the second caller's auth or
+// TLS would otherwise be silently dropped in favor of whichever client
+// created the pool first.
+func redisDSN(uopts *redis.UniversalOptions) string {
+	// Addrs are sorted before joining so the DSN key is independent of the
+	// order hosts were listed in a URI or Addrs slice.
+	addrs := append([]string(nil), uopts.Addrs...)
+	sort.Strings(addrs)
+
+	return fmt.Sprintf("%s|%s|%d|%s|%s|tls=%t",
+		strings.Join(addrs, ","), uopts.MasterName, uopts.DB,
+		uopts.Username, uopts.Password, uopts.TLSConfig != nil)
+}
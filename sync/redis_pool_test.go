@@ -0,0 +1,40 @@
+package sync
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/go-redis/redis/v7"
+)
+
+func TestRedisDSN(t *testing.T) {
+	base := &redis.UniversalOptions{Addrs: []string{"b:6379", "a:6379"}, DB: 1}
+
+	t.Run("addrs order is insignificant", func(t *testing.T) {
+		other := &redis.UniversalOptions{Addrs: []string{"a:6379", "b:6379"}, DB: 1}
+		if redisDSN(base) != redisDSN(other) {
+			t.Fatalf("expected addrs order not to affect the DSN key")
+		}
+	})
+
+	cases := []struct {
+		name string
+		o    *redis.UniversalOptions
+	}{
+		{"base", &redis.UniversalOptions{Addrs: []string{"a:6379"}}},
+		{"different db", &redis.UniversalOptions{Addrs: []string{"a:6379"}, DB: 2}},
+		{"different master name", &redis.UniversalOptions{Addrs: []string{"a:6379"}, MasterName: "mymaster"}},
+		{"different username", &redis.UniversalOptions{Addrs: []string{"a:6379"}, Username: "u"}},
+		{"different password", &redis.UniversalOptions{Addrs: []string{"a:6379"}, Password: "p"}},
+		{"tls enabled", &redis.UniversalOptions{Addrs: []string{"a:6379"}, TLSConfig: &tls.Config{}}},
+	}
+
+	seen := map[string]string{}
+	for _, tc := range cases {
+		dsn := redisDSN(tc.o)
+		if other, dup := seen[dsn]; dup {
+			t.Fatalf("redisDSN(%q) collided with %q: both produced %q", tc.name, other, dsn)
+		}
+		seen[dsn] = tc.name
+	}
+}
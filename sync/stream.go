@@ -0,0 +1,242 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+)
+
+// StreamMessage is a single entry delivered from a StreamSubscription.
+type StreamMessage struct {
+	ID      string
+	Payload []byte
+}
+
+// PublishStream appends payload to the Redis Stream backing topic, scoped to
+// the run bound to ctx, and returns the ID Redis assigned to the new entry.
+//
+// Unlike Publish/Subscribe (which use Redis pub/sub and therefore only
+// deliver to subscribers that are connected at publish time), entries
+// written with PublishStream are persisted on the stream, so a late-joining
+// SubscribeStream consumer can still replay them.
+func (c *DefaultClient) PublishStream(ctx context.Context, topic string, payload []byte) (id string, err error) {
+	key, err := c.streamKey(ctx, topic)
+	if err != nil {
+		return "", err
+	}
+
+	return c.rclient.XAdd(&redis.XAddArgs{
+		Stream: key,
+		Values: map[string]interface{}{RedisPayloadKey: payload},
+	}).Result()
+}
+
+// StreamSubscription delivers messages read from a Redis Streams-backed
+// topic under a named consumer group. Messages are pushed onto C until the
+// subscription's context is cancelled or Close is called.
+type StreamSubscription struct {
+	// C is the channel onto which messages are delivered. It is closed when
+	// the subscription terminates.
+	C <-chan StreamMessage
+
+	c        *DefaultClient
+	key      string
+	group    string
+	consumer string
+
+	cancel context.CancelFunc
+}
+
+// SubscribeStream subscribes consumer to topic's Redis Stream under the
+// named consumer group, scoped to the run bound to ctx, and returns a
+// StreamSubscription whose C channel yields messages as they are read.
+//
+// If group does not yet exist on the stream, it is created starting at from
+// (use "0" to replay the stream from the beginning, or "$" to only observe
+// entries published after the group is created). Entries that remain
+// unacknowledged for longer than the client's configured claim-idle timeout
+// (see WithStreamClaimIdle) are automatically reclaimed via XCLAIM, so that
+// a crashed consumer's backlog is picked up by a surviving one.
+func (c *DefaultClient) SubscribeStream(ctx context.Context, topic, group, consumer, from string) (*StreamSubscription, error) {
+	key, err := c.streamKey(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.rclient.XGroupCreateMkStream(key, group, from).Err()
+	if err != nil && !strings.Contains(err.Error(), "BUSYGROUP") {
+		return nil, fmt.Errorf("failed to create consumer group %q on stream %q: %w", group, key, err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	ch := make(chan StreamMessage)
+
+	sub := &StreamSubscription{
+		C:        ch,
+		c:        c,
+		key:      key,
+		group:    group,
+		consumer: consumer,
+		cancel:   cancel,
+	}
+
+	// streamWg (rather than c.wg, which is sized once in newClient for the
+	// fixed set of background workers) tracks this dynamically-started
+	// worker. Add is serialized against Close's closed check under closeMu,
+	// so a SubscribeStream racing a concurrent Close either adds before
+	// Close's streamWg.Wait or is rejected outright, and never calls Add
+	// concurrently with Wait. streamCancels is recorded under the same lock
+	// so that Close can cancel this subscription's worker even though its
+	// context was derived from the caller's ctx rather than c.ctx.
+	c.closeMu.Lock()
+	if c.closed {
+		c.closeMu.Unlock()
+		cancel()
+		return nil, fmt.Errorf("client is closed")
+	}
+	c.streamWg.Add(1)
+	c.streamCancels[sub] = cancel
+	c.closeMu.Unlock()
+
+	go c.streamWorker(ctx, sub, ch)
+
+	return sub, nil
+}
+
+// Ack acknowledges successful processing of the entry with the given id,
+// removing it from the consumer group's pending entries list so it will not
+// be auto-claimed.
+func (sub *StreamSubscription) Ack(id string) error {
+	return sub.c.rclient.XAck(sub.key, sub.group, id).Err()
+}
+
+// Close stops delivery to C and releases the subscription's background
+// goroutine. It does not delete the consumer group, so a later
+// SubscribeStream call with the same group/consumer resumes where this
+// subscription left off.
+func (sub *StreamSubscription) Close() {
+	sub.c.closeMu.Lock()
+	delete(sub.c.streamCancels, sub)
+	sub.c.closeMu.Unlock()
+
+	sub.cancel()
+}
+
+// streamWorker reads new entries for sub's consumer group, periodically
+// auto-claiming entries abandoned by other consumers, delivering both onto
+// ch until ctx is cancelled.
+func (c *DefaultClient) streamWorker(ctx context.Context, sub *StreamSubscription, ch chan<- StreamMessage) {
+	defer c.streamWg.Done()
+	defer close(ch)
+
+	claimTick := time.NewTicker(c.streamClaimIdle)
+	defer claimTick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-claimTick.C:
+			c.autoClaimStream(ctx, sub, ch)
+
+		default:
+			res, err := c.rclient.XReadGroup(&redis.XReadGroupArgs{
+				Group:    sub.group,
+				Consumer: sub.consumer,
+				Streams:  []string{sub.key, ">"},
+				Count:    64,
+				Block:    time.Second,
+			}).Result()
+
+			if err != nil {
+				if err != redis.Nil {
+					c.log.Warnw("stream read failed", "stream", sub.key, "group", sub.group, "error", err)
+				}
+				continue
+			}
+
+			for _, s := range res {
+				for _, msg := range s.Messages {
+					deliverStreamMessage(ctx, ch, toStreamMessage(msg))
+				}
+			}
+		}
+	}
+}
+
+// autoClaimStream reclaims entries that have been pending for longer than
+// the client's claim-idle timeout, assigning them to sub's consumer.
+func (c *DefaultClient) autoClaimStream(ctx context.Context, sub *StreamSubscription, ch chan<- StreamMessage) {
+	pending, err := c.rclient.XPendingExt(&redis.XPendingExtArgs{
+		Stream: sub.key,
+		Group:  sub.group,
+		Start:  "-",
+		End:    "+",
+		Count:  64,
+	}).Result()
+	if err != nil {
+		c.log.Warnw("stream xpending failed", "stream", sub.key, "group", sub.group, "error", err)
+		return
+	}
+
+	var stale []string
+	for _, p := range pending {
+		if p.Idle >= c.streamClaimIdle {
+			stale = append(stale, p.ID)
+		}
+	}
+	if len(stale) == 0 {
+		return
+	}
+
+	msgs, err := c.rclient.XClaim(&redis.XClaimArgs{
+		Stream:   sub.key,
+		Group:    sub.group,
+		Consumer: sub.consumer,
+		MinIdle:  c.streamClaimIdle,
+		Messages: stale,
+	}).Result()
+	if err != nil {
+		c.log.Warnw("stream xclaim failed", "stream", sub.key, "group", sub.group, "error", err)
+		return
+	}
+
+	for _, msg := range msgs {
+		deliverStreamMessage(ctx, ch, toStreamMessage(msg))
+	}
+}
+
+// toStreamMessage extracts the payload written by PublishStream out of a
+// raw redis.XMessage.
+func toStreamMessage(msg redis.XMessage) StreamMessage {
+	sm := StreamMessage{ID: msg.ID}
+	if v, ok := msg.Values[RedisPayloadKey]; ok {
+		if s, ok := v.(string); ok {
+			sm.Payload = []byte(s)
+		}
+	}
+	return sm
+}
+
+// deliverStreamMessage pushes msg onto ch, giving up if ctx is cancelled
+// first so a slow or absent reader cannot leak the worker goroutine.
+func deliverStreamMessage(ctx context.Context, ch chan<- StreamMessage, msg StreamMessage) {
+	select {
+	case ch <- msg:
+	case <-ctx.Done():
+	}
+}
+
+// streamKey returns the Redis key for topic's stream, scoped to the run
+// bound to ctx.
+func (c *DefaultClient) streamKey(ctx context.Context, topic string) (string, error) {
+	rp := c.extractor(ctx)
+	if rp == nil {
+		return "", ErrNoRunParameters
+	}
+	return fmt.Sprintf("run:%s:stream:%s", rp.TestRun, topic), nil
+}
@@ -0,0 +1,104 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/testground/sdk-go/runtime"
+)
+
+func newTestClient(t *testing.T, mr *miniredis.Miniredis) *DefaultClient {
+	t.Helper()
+
+	runenv := &runtime.RunEnv{RunParams: runtime.RunParams{TestRun: fmt.Sprintf("test-%d", time.Now().UnixNano())}}
+	c, err := NewBoundClient(context.Background(), runenv, WithRedisURI("redis://"+mr.Addr()+"/0"))
+	if err != nil {
+		t.Fatalf("NewBoundClient: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestPublishSubscribeStreamRoundTrip(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := newTestClient(t, mr)
+
+	ctx := context.Background()
+	if _, err := c.PublishStream(ctx, "topic", []byte("hello")); err != nil {
+		t.Fatalf("PublishStream: %v", err)
+	}
+
+	sub, err := c.SubscribeStream(ctx, "topic", "group", "consumer", "0")
+	if err != nil {
+		t.Fatalf("SubscribeStream: %v", err)
+	}
+	defer sub.Close()
+
+	select {
+	case msg := <-sub.C:
+		if string(msg.Payload) != "hello" {
+			t.Fatalf("payload = %q, want %q", msg.Payload, "hello")
+		}
+		if err := sub.Ack(msg.ID); err != nil {
+			t.Fatalf("Ack: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for published message")
+	}
+}
+
+// TestSubscribeStreamCloseRace races SubscribeStream against Close to make
+// sure neither panics nor hangs: Close must not Wait on a streamWg that a
+// concurrent SubscribeStream is still Add-ing to, and a SubscribeStream that
+// loses the race to a concurrent Close must fail cleanly instead of leaking
+// its worker goroutine.
+func TestSubscribeStreamCloseRace(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	runenv := &runtime.RunEnv{RunParams: runtime.RunParams{TestRun: "race"}}
+	c, err := NewBoundClient(context.Background(), runenv, WithRedisURI("redis://"+mr.Addr()+"/0"))
+	if err != nil {
+		t.Fatalf("NewBoundClient: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				defer func() {
+					if r := recover(); r != nil {
+						t.Errorf("SubscribeStream/Close panicked: %v", r)
+					}
+				}()
+
+				sub, err := c.SubscribeStream(context.Background(), "topic", "group", fmt.Sprintf("consumer-%d", i), "0")
+				if err == nil {
+					sub.Close()
+				}
+			}(i)
+		}
+		wg.Wait()
+	}()
+
+	// Give SubscribeStream goroutines a head start before racing Close
+	// against them.
+	time.Sleep(10 * time.Millisecond)
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("SubscribeStream/Close race did not complete: possible deadlock")
+	}
+}